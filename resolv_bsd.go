@@ -0,0 +1,39 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package resolv
+
+import "net"
+
+// config returns the current DNS resolver configuration as reported by
+// /etc/resolv.conf.
+func config() (Config, error) {
+	return parseResolvConf(resolvConfPath)
+}
+
+// ServerAddrs returns local DNS resolver IP addresses
+func ServerAddrs() ([]net.IP, error) {
+	resolvers, err := Resolvers()
+	if err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+	return resolvers[0].ServerAddresses, nil
+}
+
+// Resolvers returns the merged DNS resolver configuration as a
+// single-element slice.
+func Resolvers() ([]Resolver, error) {
+	cfg, err := config()
+	if err != nil {
+		return nil, err
+	}
+	return []Resolver{{
+		ServerAddresses: cfg.Servers,
+		SearchDomains:   cfg.Search,
+		DomainName:      cfg.Domain,
+		Options:         cfg.Options,
+	}}, nil
+}
@@ -0,0 +1,652 @@
+//go:build darwin
+// +build darwin
+
+package resolv
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework SystemConfiguration
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <SystemConfiguration/SCDynamicStore.h>
+
+extern void dnsChangeCallback(SCDynamicStoreRef store, CFArrayRef changedKeys, void *info);
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// StringToCFString returns a CFStringRef.
+//
+// The CFStringRef type refers to a CFString object, which "encapsulates"
+// a Unicode string along with its length.
+//
+// It is callers responsibility to release the memory using Release()
+func StringToCFString(s string) (C.CFStringRef, error) {
+	if !utf8.ValidString(s) {
+		return 0, errors.New("invalid UTF-8 string")
+	}
+	if uint64(len(s)) > math.MaxUint32 {
+		return 0, errors.New("string is too big")
+	}
+
+	bytes := []byte(s)
+	var p *C.UInt8
+	if len(bytes) > 0 {
+		p = (*C.UInt8)(&bytes[0])
+	}
+	return C.CFStringCreateWithBytes(C.kCFAllocatorDefault, p, C.CFIndex(len(s)), C.kCFStringEncodingUTF8, C.false), nil
+}
+
+// Release releases a TypeRef
+func Release(ref C.CFTypeRef) {
+	if ref != 0 {
+		C.CFRelease(ref)
+	}
+}
+
+// CFDictionaryToPointerMap converts CFDictionaryRef to a map of pointers
+func CFDictionaryToPointerMap(ref C.CFDictionaryRef) (m map[C.CFTypeRef]C.CFTypeRef) {
+	count := C.CFDictionaryGetCount(ref)
+	if count > 0 {
+		keys := make([]C.CFTypeRef, count)
+		values := make([]C.CFTypeRef, count)
+		// keys and values C arrays are parallel to each other. that is, the items
+		// at the same indices form a key-value pair from the dictionary
+		C.CFDictionaryGetKeysAndValues(ref, (*unsafe.Pointer)(unsafe.Pointer(&keys[0])), (*unsafe.Pointer)(unsafe.Pointer(&values[0])))
+		m = make(map[C.CFTypeRef]C.CFTypeRef, count)
+		for i := C.CFIndex(0); i < count; i++ {
+			m[keys[i]] = values[i]
+		}
+	}
+	return
+}
+
+// CFStringToString converts a CFStringRef to a string
+func CFStringToString(ref C.CFStringRef) string {
+	p := C.CFStringGetCStringPtr(ref, C.kCFStringEncodingUTF8)
+	if p != nil {
+		return C.GoString(p)
+	}
+	length := C.CFStringGetLength(ref)
+	if length == 0 {
+		return ""
+	}
+	maxBufLen := C.CFStringGetMaximumSizeForEncoding(length, C.kCFStringEncodingUTF8)
+	if maxBufLen == 0 {
+		return ""
+	}
+	buf := make([]byte, maxBufLen)
+	var usedBufLen C.CFIndex
+	_ = C.CFStringGetBytes(ref, C.CFRange{0, length}, C.kCFStringEncodingUTF8, C.UInt8(0), C.false, (*C.UInt8)(&buf[0]), maxBufLen, &usedBufLen)
+	return string(buf[:usedBufLen])
+}
+
+// CFArrayToArray converts a CFArrayRef to an array of CFTypes
+func CFArrayToArray(ref C.CFArrayRef) (a []C.CFTypeRef) {
+	count := C.CFArrayGetCount(ref)
+	if count > 0 {
+		a = make([]C.CFTypeRef, count)
+		C.CFArrayGetValues(ref, C.CFRange{0, count}, (*unsafe.Pointer)(unsafe.Pointer(&a[0])))
+	}
+	return
+}
+
+// CFTypeDescription returns type string for CFTypeRef
+func CFTypeDescription(ref C.CFTypeRef) string {
+	typeID := C.CFGetTypeID(ref)
+	typeDesc := C.CFCopyTypeIDDescription(typeID)
+	defer Release(C.CFTypeRef(typeDesc))
+	return CFStringToString(typeDesc)
+}
+
+// cfReferenceDate is the epoch CFAbsoluteTime values are measured from:
+// midnight, January 1, 2001, UTC.
+var cfReferenceDate = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// convertCFNumber converts a CFNumberRef to an int64, or a float64 if the
+// underlying CFNumberType is a floating point type.
+func convertCFNumber(ref C.CFNumberRef) (interface{}, error) {
+	switch C.CFNumberGetType(ref) {
+	case C.kCFNumberFloat32Type, C.kCFNumberFloat64Type, C.kCFNumberFloatType, C.kCFNumberDoubleType, C.kCFNumberCGFloatType:
+		var v C.double
+		if C.CFNumberGetValue(ref, C.kCFNumberDoubleType, unsafe.Pointer(&v)) == C.false {
+			return nil, fmt.Errorf("failed to read CFNumber as double")
+		}
+		return float64(v), nil
+	default:
+		var v C.longlong
+		if C.CFNumberGetValue(ref, C.kCFNumberLongLongType, unsafe.Pointer(&v)) == C.false {
+			return nil, fmt.Errorf("failed to read CFNumber as int64")
+		}
+		return int64(v), nil
+	}
+}
+
+// convertCFDate converts a CFDateRef, which stores seconds relative to
+// cfReferenceDate, to a time.Time.
+func convertCFDate(ref C.CFDateRef) time.Time {
+	abs := C.CFDateGetAbsoluteTime(ref)
+	return cfReferenceDate.Add(time.Duration(float64(abs) * float64(time.Second)))
+}
+
+// Convert converts a CFTypeRef to a go value
+func Convert(ref C.CFTypeRef) (interface{}, error) {
+	typeID := C.CFGetTypeID(ref)
+	if typeID == C.CFStringGetTypeID() {
+		return CFStringToString(C.CFStringRef(ref)), nil
+	} else if typeID == C.CFDictionaryGetTypeID() {
+		return CFDictionaryToMap(C.CFDictionaryRef(ref))
+	} else if typeID == C.CFArrayGetTypeID() {
+		arr := CFArrayToArray(C.CFArrayRef(ref))
+		results := make([]interface{}, 0, len(arr))
+		for _, ref := range arr {
+			v, err := Convert(ref)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, v)
+		}
+		return results, nil
+	} else if typeID == C.CFNumberGetTypeID() {
+		return convertCFNumber(C.CFNumberRef(ref))
+	} else if typeID == C.CFBooleanGetTypeID() {
+		return C.CFBooleanGetValue(C.CFBooleanRef(ref)) == C.true, nil
+	} else if typeID == C.CFDataGetTypeID() {
+		data := C.CFDataRef(ref)
+		return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data))), nil
+	} else if typeID == C.CFDateGetTypeID() {
+		return convertCFDate(C.CFDateRef(ref)), nil
+	}
+	return nil, fmt.Errorf("invalid type: %s", CFTypeDescription(ref))
+}
+
+// CFDictionaryToMap returns a regular go map
+func CFDictionaryToMap(ref C.CFDictionaryRef) (map[interface{}]interface{}, error) {
+	result := make(map[interface{}]interface{})
+	for k, v := range CFDictionaryToPointerMap(ref) {
+		gk, err := Convert(k)
+		if err != nil {
+			return nil, err
+		}
+		gv, err := Convert(v)
+		if err != nil {
+			return nil, err
+		}
+		result[gk] = gv
+	}
+	return result, nil
+}
+
+// ParseDNSResponse attempts to parse DNS response from dynamic store
+func ParseDNSResponse(m map[interface{}]interface{}) ([]net.IP, error) {
+	if m["ServerAddresses"] == nil {
+		return nil, fmt.Errorf("empty server list")
+	}
+	var addrs []net.IP
+	if slice, ok := m["ServerAddresses"].([]interface{}); ok {
+		for _, addr := range slice {
+			if str, ok := addr.(string); ok {
+				ip := net.ParseIP(str)
+				if ip == nil {
+					continue
+				}
+				addrs = append(addrs, ip)
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// globalDNSDict fetches the "State:/Network/Global/DNS" dictionary from the
+// System Configuration dynamic store.
+func globalDNSDict() (map[interface{}]interface{}, error) {
+	// caller name for dynamic store
+	caller, err := StringToCFString("com.romantomjak.resolver")
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(caller))
+
+	// key to query system configuration
+	key, err := StringToCFString("State:/Network/Global/DNS")
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(key))
+
+	// create a new session used to interact with the dynamic store maintained
+	// by the System Configuration server. the dynamic store contains, among
+	// other items, information about the current network state
+	store := C.SCDynamicStoreCreate(C.kCFAllocatorSystemDefault, caller, nil, nil)
+	defer Release(C.CFTypeRef(store))
+
+	val := C.SCDynamicStoreCopyValue(store, key)
+	defer Release(C.CFTypeRef(val))
+
+	return CFDictionaryToMap(C.CFDictionaryRef(val))
+}
+
+// config returns the current DNS resolver configuration.
+func config() (Config, error) {
+	dict, err := globalDNSDict()
+	if err != nil {
+		return Config{}, err
+	}
+
+	r, err := parseResolver(dict)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{
+		Servers: r.ServerAddresses,
+		Search:  r.SearchDomains,
+		Domain:  r.DomainName,
+		Options: r.Options,
+	}, nil
+}
+
+// ServerAddrs returns local DNS resolver IP addresses
+func ServerAddrs() ([]net.IP, error) {
+	resolvers, err := Resolvers()
+	if err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+	return resolvers[0].ServerAddresses, nil
+}
+
+// Resolvers returns the merged, global DNS resolver configuration as a
+// single-element slice. Unlike ServerAddrs, it preserves search domains,
+// sort lists, and the other fields the System Configuration framework
+// reports alongside the server list.
+func Resolvers() ([]Resolver, error) {
+	dict, err := globalDNSDict()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := parseResolver(dict)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Resolver{r}, nil
+}
+
+// parseSortListEntry parses a System Configuration sortlist entry of the
+// form "address/dotted-netmask" (e.g. "17.228.0.0/255.255.0.0"). Unlike
+// net.ParseCIDR, the mask here is a dotted quad rather than a prefix
+// length, so it's parsed and applied by hand.
+func parseSortListEntry(s string) (net.IPNet, bool) {
+	addrStr, maskStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return net.IPNet{}, false
+	}
+
+	addr := net.ParseIP(addrStr)
+	maskIP := net.ParseIP(maskStr)
+	if addr == nil || maskIP == nil {
+		return net.IPNet{}, false
+	}
+
+	var mask net.IPMask
+	if v4 := maskIP.To4(); v4 != nil {
+		addr, mask = addr.To4(), net.IPMask(v4)
+	} else {
+		if addr.To4() != nil {
+			return net.IPNet{}, false
+		}
+		mask = net.IPMask(maskIP.To16())
+	}
+	if addr == nil || len(addr) != len(mask) {
+		return net.IPNet{}, false
+	}
+
+	return net.IPNet{IP: addr, Mask: mask}, true
+}
+
+// parseResolver extracts a Resolver from a DNS dictionary as returned by
+// the dynamic store, e.g. from "State:/Network/Global/DNS" or
+// "State:/Network/Service/<uuid>/DNS".
+func parseResolver(m map[interface{}]interface{}) (Resolver, error) {
+	addrs, err := ParseDNSResponse(m)
+	if err != nil {
+		return Resolver{}, err
+	}
+
+	r := Resolver{ServerAddresses: addrs}
+
+	if v, ok := m["SearchDomains"].([]interface{}); ok {
+		for _, d := range v {
+			if s, ok := d.(string); ok {
+				r.SearchDomains = append(r.SearchDomains, s)
+			}
+		}
+	}
+
+	if v, ok := m["SupplementalMatchDomains"].([]interface{}); ok {
+		for _, d := range v {
+			if s, ok := d.(string); ok {
+				r.SupplementalMatchDomains = append(r.SupplementalMatchDomains, s)
+			}
+		}
+	}
+
+	if v, ok := m["DomainName"].(string); ok {
+		r.DomainName = v
+	}
+
+	if v, ok := m["SortList"].([]interface{}); ok {
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				continue
+			}
+			if ipnet, ok := parseSortListEntry(s); ok {
+				r.SortList = append(r.SortList, ipnet)
+			}
+		}
+	}
+
+	if v, ok := m["PortNumber"].(int64); ok {
+		r.Port = int(v)
+	}
+
+	if v, ok := m["Timeout"].(int64); ok {
+		r.Timeout = time.Duration(v) * time.Second
+	}
+
+	if v, ok := m["Options"].(string); ok {
+		r.Options = strings.Fields(v)
+	}
+
+	return r, nil
+}
+
+// watch tracks the state a single Watch call needs in order to tear down
+// its run loop again once the caller is done with it.
+type watch struct {
+	ch      chan Config
+	runLoop C.CFRunLoopRef
+	store   C.SCDynamicStoreRef
+	source  C.CFRunLoopSourceRef
+	stop    chan struct{}
+}
+
+var (
+	watchesMu sync.Mutex
+	watches   = make(map[int]*watch)
+	watchSeq  int
+)
+
+// Watch subscribes to DNS resolver configuration changes and emits the
+// current Config on the returned channel every time macOS swaps the active
+// resolver (VPN up/down, Wi-Fi switch, etc.). The channel is closed once
+// ctx is done.
+func Watch(ctx context.Context) (<-chan Config, error) {
+	watchesMu.Lock()
+	watchSeq++
+	id := watchSeq
+	watchesMu.Unlock()
+
+	ch := make(chan Config, 1)
+	ready := make(chan error, 1)
+
+	go runWatchLoop(id, ch, ready)
+
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		stopWatch(id)
+	}()
+
+	return ch, nil
+}
+
+// runWatchLoop registers for "State:/Network/Global/DNS" change
+// notifications and runs a CFRunLoop to receive them. It must run on a
+// dedicated OS thread, since CFRunLoopRun affects only the calling thread.
+func runWatchLoop(id int, ch chan Config, ready chan<- error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	caller, err := StringToCFString("com.romantomjak.resolver")
+	if err != nil {
+		ready <- err
+		return
+	}
+	defer Release(C.CFTypeRef(caller))
+
+	key, err := StringToCFString("State:/Network/Global/DNS")
+	if err != nil {
+		ready <- err
+		return
+	}
+	defer Release(C.CFTypeRef(key))
+
+	// info is an opaque pointer handed back to us in dnsChangeCallback, used
+	// to look up which watch the notification belongs to
+	info := C.malloc(C.size_t(unsafe.Sizeof(C.int(0))))
+	defer C.free(info)
+	*(*C.int)(info) = C.int(id)
+
+	var cctx C.SCDynamicStoreContext
+	cctx.info = info
+
+	store := C.SCDynamicStoreCreate(C.kCFAllocatorSystemDefault, caller, C.SCDynamicStoreCallBack(C.dnsChangeCallback), &cctx)
+	if store == 0 {
+		ready <- errors.New("failed to create dynamic store")
+		return
+	}
+
+	keys := C.CFArrayCreate(C.kCFAllocatorDefault, (*unsafe.Pointer)(unsafe.Pointer(&key)), 1, nil)
+	defer Release(C.CFTypeRef(keys))
+
+	if C.SCDynamicStoreSetNotificationKeys(store, keys, nil) == C.false {
+		Release(C.CFTypeRef(store))
+		ready <- errors.New("failed to set notification keys")
+		return
+	}
+
+	source := C.SCDynamicStoreCreateRunLoopSource(C.kCFAllocatorDefault, store, 0)
+	runLoop := C.CFRunLoopGetCurrent()
+	C.CFRunLoopAddSource(runLoop, source, C.kCFRunLoopDefaultMode)
+
+	stop := make(chan struct{})
+	watchesMu.Lock()
+	watches[id] = &watch{ch: ch, runLoop: runLoop, store: store, source: source, stop: stop}
+	watchesMu.Unlock()
+
+	ready <- nil
+
+	for {
+		select {
+		case <-stop:
+			C.CFRunLoopRemoveSource(runLoop, source, C.kCFRunLoopDefaultMode)
+			Release(C.CFTypeRef(source))
+			Release(C.CFTypeRef(store))
+			close(ch)
+			return
+		default:
+			C.CFRunLoopRunInMode(C.kCFRunLoopDefaultMode, 1, C.false)
+		}
+	}
+}
+
+// stopWatch signals runWatchLoop to tear down the watch registered under id.
+func stopWatch(id int) {
+	watchesMu.Lock()
+	w, ok := watches[id]
+	if ok {
+		delete(watches, id)
+	}
+	watchesMu.Unlock()
+	if ok {
+		close(w.stop)
+	}
+}
+
+//export dnsChangeCallback
+func dnsChangeCallback(store C.SCDynamicStoreRef, changedKeys C.CFArrayRef, info unsafe.Pointer) {
+	id := int(*(*C.int)(info))
+
+	watchesMu.Lock()
+	w, ok := watches[id]
+	watchesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	cfg, err := config()
+	if err != nil {
+		return
+	}
+
+	select {
+	case w.ch <- cfg:
+	default:
+	}
+}
+
+// ResolversForInterface returns the DNS resolver configuration for the
+// network service whose primary interface is name (e.g. "en0"). This is
+// what callers need to pick a resolver scoped to a specific VPN tunnel
+// rather than relying on the global merged view.
+func ResolversForInterface(name string) ([]Resolver, error) {
+	all, err := AllResolvers()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []Resolver
+	for _, r := range all {
+		if r.InterfaceName == name {
+			matched = append(matched, r)
+		}
+	}
+	return matched, nil
+}
+
+// AllResolvers returns the DNS resolver configuration for every network
+// service, each tagged with the interface it belongs to.
+func AllResolvers() ([]Resolver, error) {
+	caller, err := StringToCFString("com.romantomjak.resolver")
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(caller))
+
+	store := C.SCDynamicStoreCreate(C.kCFAllocatorSystemDefault, caller, nil, nil)
+	if store == 0 {
+		return nil, errors.New("failed to create dynamic store")
+	}
+	defer Release(C.CFTypeRef(store))
+
+	pattern, err := StringToCFString("State:/Network/Service/.*/DNS")
+	if err != nil {
+		return nil, err
+	}
+	defer Release(C.CFTypeRef(pattern))
+
+	keys := C.SCDynamicStoreCopyKeyList(store, pattern)
+	if keys == 0 {
+		return nil, nil
+	}
+	defer Release(C.CFTypeRef(keys))
+
+	var resolvers []Resolver
+	for _, keyRef := range CFArrayToArray(keys) {
+		key := C.CFStringRef(keyRef)
+
+		serviceID, ok := serviceIDFromDNSKey(CFStringToString(key))
+		if !ok {
+			continue
+		}
+
+		val := C.SCDynamicStoreCopyValue(store, key)
+		if val == 0 {
+			continue
+		}
+		dict, err := CFDictionaryToMap(C.CFDictionaryRef(val))
+		Release(C.CFTypeRef(val))
+		if err != nil {
+			continue
+		}
+
+		r, err := parseResolver(dict)
+		if err != nil {
+			continue
+		}
+
+		if ifaceName, ifaceIndex, ok := interfaceForService(store, serviceID); ok {
+			r.InterfaceName = ifaceName
+			r.InterfaceIndex = ifaceIndex
+		}
+
+		resolvers = append(resolvers, r)
+	}
+
+	return resolvers, nil
+}
+
+// serviceIDFromDNSKey extracts the service UUID from a
+// "State:/Network/Service/<uuid>/DNS" dynamic store key.
+func serviceIDFromDNSKey(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 5 || parts[4] != "DNS" {
+		return "", false
+	}
+	return parts[3], true
+}
+
+// interfaceForService looks up the BSD interface name and index for the
+// network service identified by serviceID, via its
+// "Setup:/Network/Service/<uuid>/Interface" entry.
+func interfaceForService(store C.SCDynamicStoreRef, serviceID string) (string, int, bool) {
+	key, err := StringToCFString(fmt.Sprintf("Setup:/Network/Service/%s/Interface", serviceID))
+	if err != nil {
+		return "", 0, false
+	}
+	defer Release(C.CFTypeRef(key))
+
+	val := C.SCDynamicStoreCopyValue(store, key)
+	if val == 0 {
+		return "", 0, false
+	}
+	defer Release(C.CFTypeRef(val))
+
+	dict, err := CFDictionaryToMap(C.CFDictionaryRef(val))
+	if err != nil {
+		return "", 0, false
+	}
+
+	name, ok := dict["DeviceName"].(string)
+	if !ok || name == "" {
+		return "", 0, false
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return name, 0, true
+	}
+
+	return name, iface.Index, true
+}
@@ -0,0 +1,200 @@
+//go:build darwin
+// +build darwin
+
+package resolv
+
+/*
+#include <CoreFoundation/CoreFoundation.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// TestConvertRoundTrip builds a CF container from a Go value with goToCF,
+// runs it back through Convert, and checks the result matches what went
+// in. This is what exercises Convert, convertCFNumber and convertCFDate,
+// since there's no way to assert against the live dynamic store in a
+// test.
+func TestConvertRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+	}{
+		{"string", "hello"},
+		{"int64", int64(42)},
+		{"float64", float64(3.25)},
+		{"bool true", true},
+		{"bool false", false},
+		{"bytes", []byte{1, 2, 3}},
+		{"date", time.Date(2020, time.June, 15, 12, 30, 0, 0, time.UTC)},
+		{"array", []interface{}{"a", int64(1), true}},
+		{"dict", map[interface{}]interface{}{"k": "v"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ref, err := goToCF(c.in)
+			if err != nil {
+				t.Fatalf("goToCF(%v): %v", c.in, err)
+			}
+			defer Release(ref)
+
+			got, err := Convert(ref)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.in) {
+				t.Errorf("round trip mismatch: got %#v, want %#v", got, c.in)
+			}
+		})
+	}
+}
+
+// TestParseSortListEntry covers the dotted-netmask sortlist syntax System
+// Configuration reports (e.g. "17.228.0.0/255.255.0.0"), and the malformed
+// inputs that should be rejected rather than silently misparsed.
+func TestParseSortListEntry(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		wantOK  bool
+		wantNet net.IPNet
+	}{
+		{
+			name:   "good entry",
+			in:     "17.228.0.0/255.255.0.0",
+			wantOK: true,
+			wantNet: net.IPNet{
+				IP:   net.IPv4(17, 228, 0, 0).To4(),
+				Mask: net.IPMask(net.IPv4(255, 255, 0, 0).To4()),
+			},
+		},
+		{
+			name:   "missing slash",
+			in:     "17.228.0.0 255.255.0.0",
+			wantOK: false,
+		},
+		{
+			name:   "garbage mask",
+			in:     "17.228.0.0/not-a-mask",
+			wantOK: false,
+		},
+		{
+			name:   "v4 address with v6 mask",
+			in:     "17.228.0.0/ffff:ffff::",
+			wantOK: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := parseSortListEntry(c.in)
+			if ok != c.wantOK {
+				t.Fatalf("parseSortListEntry(%q) ok = %v, want %v", c.in, ok, c.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !got.IP.Equal(c.wantNet.IP) || got.Mask.String() != c.wantNet.Mask.String() {
+				t.Errorf("parseSortListEntry(%q) = %v, want %v", c.in, got, c.wantNet)
+			}
+		})
+	}
+}
+
+// goToCF builds a CFTypeRef from a Go value, the reverse of Convert. It
+// only exists to round-trip test Convert, so it only needs to handle the
+// types Convert itself knows how to produce.
+func goToCF(v interface{}) (C.CFTypeRef, error) {
+	switch x := v.(type) {
+	case string:
+		ref, err := StringToCFString(x)
+		return C.CFTypeRef(ref), err
+
+	case int64:
+		cv := C.longlong(x)
+		return C.CFTypeRef(C.CFNumberCreate(C.kCFAllocatorDefault, C.kCFNumberLongLongType, unsafe.Pointer(&cv))), nil
+
+	case float64:
+		cv := C.double(x)
+		return C.CFTypeRef(C.CFNumberCreate(C.kCFAllocatorDefault, C.kCFNumberDoubleType, unsafe.Pointer(&cv))), nil
+
+	case bool:
+		if x {
+			return C.CFTypeRef(C.kCFBooleanTrue), nil
+		}
+		return C.CFTypeRef(C.kCFBooleanFalse), nil
+
+	case []byte:
+		var p *C.UInt8
+		if len(x) > 0 {
+			p = (*C.UInt8)(&x[0])
+		}
+		return C.CFTypeRef(C.CFDataCreate(C.kCFAllocatorDefault, p, C.CFIndex(len(x)))), nil
+
+	case time.Time:
+		abs := C.CFAbsoluteTime(x.Sub(cfReferenceDate).Seconds())
+		return C.CFTypeRef(C.CFDateCreate(C.kCFAllocatorDefault, abs)), nil
+
+	case []interface{}:
+		refs := make([]C.CFTypeRef, len(x))
+		for i, e := range x {
+			ref, err := goToCF(e)
+			if err != nil {
+				return 0, err
+			}
+			refs[i] = ref
+		}
+		defer func() {
+			for _, ref := range refs {
+				Release(ref)
+			}
+		}()
+
+		var p *unsafe.Pointer
+		if len(refs) > 0 {
+			p = (*unsafe.Pointer)(unsafe.Pointer(&refs[0]))
+		}
+		return C.CFTypeRef(C.CFArrayCreate(C.kCFAllocatorDefault, p, C.CFIndex(len(refs)), &C.kCFTypeArrayCallBacks)), nil
+
+	case map[interface{}]interface{}:
+		keys := make([]C.CFTypeRef, 0, len(x))
+		values := make([]C.CFTypeRef, 0, len(x))
+		for k, val := range x {
+			kr, err := goToCF(k)
+			if err != nil {
+				return 0, err
+			}
+			vr, err := goToCF(val)
+			if err != nil {
+				return 0, err
+			}
+			keys = append(keys, kr)
+			values = append(values, vr)
+		}
+		defer func() {
+			for i := range keys {
+				Release(keys[i])
+				Release(values[i])
+			}
+		}()
+
+		var kp, vp *unsafe.Pointer
+		if len(keys) > 0 {
+			kp = (*unsafe.Pointer)(unsafe.Pointer(&keys[0]))
+			vp = (*unsafe.Pointer)(unsafe.Pointer(&values[0]))
+		}
+		return C.CFTypeRef(C.CFDictionaryCreate(C.kCFAllocatorDefault, kp, vp, C.CFIndex(len(keys)),
+			&C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks)), nil
+
+	default:
+		return 0, fmt.Errorf("goToCF: unsupported type %T", v)
+	}
+}
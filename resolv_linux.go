@@ -0,0 +1,221 @@
+//go:build linux
+// +build linux
+
+package resolv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+// resolvedDest is the well-known bus name systemd-resolved publishes its
+// Manager object under.
+const resolvedDest = "org.freedesktop.resolve1"
+
+// resolvedPath is the object path of systemd-resolved's Manager object.
+const resolvedPath = dbus.ObjectPath("/org/freedesktop/resolve1")
+
+// config returns the current DNS resolver configuration. systemd-resolved
+// is consulted first when it's running, since it holds the authoritative,
+// per-link merged view; /etc/resolv.conf is the fallback everywhere else.
+func config() (Config, error) {
+	if cfg, err := resolvedConfig(); err == nil {
+		return cfg, nil
+	}
+	return parseResolvConf(resolvConfPath)
+}
+
+// resolvedDNSServer mirrors the (ifindex, family, address) tuples returned
+// by systemd-resolved's "DNS" property.
+type resolvedDNSServer struct {
+	IfIndex int32
+	Family  int32
+	Address []byte
+}
+
+// resolvedConfig reads the global DNS server list from systemd-resolved's
+// Manager object over the system D-Bus.
+func resolvedConfig() (Config, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return Config{}, err
+	}
+	defer conn.Close()
+
+	obj := conn.Object(resolvedDest, resolvedPath)
+
+	variant, err := obj.GetProperty(resolvedDest + ".Manager.DNS")
+	if err != nil {
+		return Config{}, err
+	}
+
+	var raw []resolvedDNSServer
+	if err := variant.Store(&raw); err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	for _, s := range raw {
+		cfg.Servers = append(cfg.Servers, net.IP(s.Address))
+	}
+	if len(cfg.Servers) == 0 {
+		return Config{}, fmt.Errorf("systemd-resolved: no DNS servers")
+	}
+	return cfg, nil
+}
+
+// ServerAddrs returns local DNS resolver IP addresses
+func ServerAddrs() ([]net.IP, error) {
+	resolvers, err := Resolvers()
+	if err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+	return resolvers[0].ServerAddresses, nil
+}
+
+// Resolvers returns the merged DNS resolver configuration as a
+// single-element slice.
+func Resolvers() ([]Resolver, error) {
+	cfg, err := config()
+	if err != nil {
+		return nil, err
+	}
+	return []Resolver{{
+		ServerAddresses: cfg.Servers,
+		SearchDomains:   cfg.Search,
+		DomainName:      cfg.Domain,
+		Options:         cfg.Options,
+	}}, nil
+}
+
+// Watch subscribes to DNS resolver configuration changes and emits the
+// current Config on the returned channel whenever /etc/resolv.conf is
+// rewritten, or systemd-resolved reports new settings over D-Bus. The
+// channel is closed once ctx is done.
+func Watch(ctx context.Context) (<-chan Config, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	// Watch the containing directory rather than resolvConfPath itself:
+	// resolvconf, NetworkManager and systemd-resolved all replace it via an
+	// atomic rename/relink, which would invalidate a watch on the old inode
+	// and leave us deaf to every subsequent change.
+	dir := filepath.Dir(resolvConfPath)
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_CREATE|unix.IN_DELETE); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	changed := make(chan struct{}, 1)
+	go readInotifyEvents(fd, filepath.Base(resolvConfPath), changed)
+
+	resolvedChanged := watchResolvedSignals(ctx)
+
+	ch := make(chan Config, 1)
+	go func() {
+		defer unix.Close(fd)
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			case <-resolvedChanged:
+			}
+			if cfg, err := config(); err == nil {
+				select {
+				case ch <- cfg:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// readInotifyEvents blocks reading directory inotify events off fd,
+// signalling changed whenever one of them names file. It returns once fd
+// is closed.
+func readInotifyEvents(fd int, file string, changed chan<- struct{}) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil || n == 0 {
+			return
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			next := off + unix.SizeofInotifyEvent + int(raw.Len)
+			if next > n {
+				break
+			}
+
+			if raw.Len > 0 {
+				name := string(bytes.TrimRight(buf[off+unix.SizeofInotifyEvent:next], "\x00"))
+				if name == file {
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				}
+			}
+
+			off = next
+		}
+	}
+}
+
+// watchResolvedSignals subscribes to systemd-resolved's PropertiesChanged
+// signal on the Manager object, returning nil if the system bus can't be
+// reached or the match rule can't be added.
+func watchResolvedSignals(ctx context.Context) <-chan struct{} {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(resolvedPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		conn.Close()
+		return nil
+	}
+
+	signals := make(chan *dbus.Signal, 8)
+	conn.Signal(signals)
+
+	out := make(chan struct{}, 1)
+	go func() {
+		defer conn.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-signals:
+				if !ok {
+					return
+				}
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,58 @@
+//go:build linux || freebsd || openbsd
+// +build linux freebsd openbsd
+
+package resolv
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// resolvConfPath is the well-known location of the resolver configuration
+// file on Linux and the BSDs.
+const resolvConfPath = "/etc/resolv.conf"
+
+// parseResolvConf reads and parses a resolv.conf(5) style file, honoring
+// the "nameserver", "search", "domain" and "options" directives.
+func parseResolvConf(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	var cfg Config
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if ip := net.ParseIP(fields[1]); ip != nil {
+				cfg.Servers = append(cfg.Servers, ip)
+			}
+		case "search":
+			cfg.Search = append(cfg.Search, fields[1:]...)
+		case "domain":
+			cfg.Domain = fields[1]
+		case "options":
+			cfg.Options = append(cfg.Options, fields[1:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
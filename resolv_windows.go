@@ -0,0 +1,199 @@
+//go:build windows
+// +build windows
+
+package resolv
+
+import (
+	"context"
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// iphlpapi exposes the interface-change notification API; x/sys/windows
+// doesn't wrap it, so we call it directly as a LazyDLL proc.
+var (
+	modiphlpapi                 = syscall.NewLazyDLL("iphlpapi.dll")
+	procNotifyIpInterfaceChange = modiphlpapi.NewProc("NotifyIpInterfaceChange")
+	procCancelMibChangeNotify2  = modiphlpapi.NewProc("CancelMibChangeNotify2")
+)
+
+// notifyIPInterfaceChange wraps the NotifyIpInterfaceChange iphlpapi call.
+func notifyIPInterfaceChange(family uint32, callback uintptr, callerContext uintptr, initialNotification bool, handle *windows.Handle) error {
+	var init uintptr
+	if initialNotification {
+		init = 1
+	}
+	r0, _, _ := procNotifyIpInterfaceChange.Call(uintptr(family), callback, callerContext, init, uintptr(unsafe.Pointer(handle)))
+	if r0 != 0 {
+		return syscall.Errno(r0)
+	}
+	return nil
+}
+
+// cancelMibChangeNotify2 wraps the CancelMibChangeNotify2 iphlpapi call.
+func cancelMibChangeNotify2(handle windows.Handle) error {
+	r0, _, _ := procCancelMibChangeNotify2.Call(uintptr(handle))
+	if r0 != 0 {
+		return syscall.Errno(r0)
+	}
+	return nil
+}
+
+// config returns the current DNS resolver configuration by asking
+// iphlpapi.dll for the per-adapter DNS server list and merging it into a
+// single, de-duplicated view.
+func config() (Config, error) {
+	addrs, err := adapterAddresses()
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	seen := make(map[string]bool)
+	for _, aa := range addrs {
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			ip := sockaddrToIP(dns.Address.Sockaddr)
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			cfg.Servers = append(cfg.Servers, ip)
+		}
+		if aa.DnsSuffix != nil {
+			if suffix := windows.UTF16PtrToString(aa.DnsSuffix); suffix != "" {
+				cfg.Search = append(cfg.Search, suffix)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// adapterAddresses wraps GetAdaptersAddresses, growing the result buffer
+// until it's large enough to hold every adapter.
+func adapterAddresses() ([]*windows.IpAdapterAddresses, error) {
+	l := uint32(15000) // recommended starting size, per MSDN
+	var buf []byte
+	for {
+		buf = make([]byte, l)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_PREFIX, 0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &l)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, err
+		}
+	}
+
+	var addrs []*windows.IpAdapterAddresses
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		addrs = append(addrs, aa)
+	}
+	return addrs, nil
+}
+
+// sockaddrToIP extracts a net.IP from a raw Win32 SOCKET_ADDRESS.
+func sockaddrToIP(sa *syscall.RawSockaddrAny) net.IP {
+	if sa == nil {
+		return nil
+	}
+	switch sa.Addr.Family {
+	case syscall.AF_INET:
+		p := (*syscall.RawSockaddrInet4)(unsafe.Pointer(sa))
+		return net.IP(p.Addr[:])
+	case syscall.AF_INET6:
+		p := (*syscall.RawSockaddrInet6)(unsafe.Pointer(sa))
+		return net.IP(p.Addr[:])
+	}
+	return nil
+}
+
+// ServerAddrs returns local DNS resolver IP addresses
+func ServerAddrs() ([]net.IP, error) {
+	resolvers, err := Resolvers()
+	if err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, nil
+	}
+	return resolvers[0].ServerAddresses, nil
+}
+
+// Resolvers returns the merged DNS resolver configuration as a
+// single-element slice.
+func Resolvers() ([]Resolver, error) {
+	cfg, err := config()
+	if err != nil {
+		return nil, err
+	}
+	return []Resolver{{
+		ServerAddresses: cfg.Servers,
+		SearchDomains:   cfg.Search,
+		DomainName:      cfg.Domain,
+		Options:         cfg.Options,
+	}}, nil
+}
+
+var (
+	watchersMu sync.Mutex
+	watchers   = make(map[uintptr]chan Config)
+	watchSeq   uintptr
+)
+
+// Watch subscribes to DNS resolver configuration changes and emits the
+// current Config on the returned channel whenever an IP interface changes,
+// as reported by NotifyIpInterfaceChange. The channel is closed once ctx
+// is done.
+func Watch(ctx context.Context) (<-chan Config, error) {
+	ch := make(chan Config, 1)
+
+	watchersMu.Lock()
+	watchSeq++
+	id := watchSeq
+	watchers[id] = ch
+	watchersMu.Unlock()
+
+	var handle windows.Handle
+	cb := syscall.NewCallback(ipInterfaceChangeCallback)
+	if err := notifyIPInterfaceChange(windows.AF_UNSPEC, cb, id, false, &handle); err != nil {
+		watchersMu.Lock()
+		delete(watchers, id)
+		watchersMu.Unlock()
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		cancelMibChangeNotify2(handle)
+		watchersMu.Lock()
+		delete(watchers, id)
+		watchersMu.Unlock()
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// ipInterfaceChangeCallback is invoked by NotifyIpInterfaceChange on every
+// interface change; callerContext is the watch id passed to it in Watch.
+func ipInterfaceChangeCallback(callerContext uintptr, row uintptr, notificationType uint32) uintptr {
+	watchersMu.Lock()
+	ch, ok := watchers[callerContext]
+	watchersMu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	if cfg, err := config(); err == nil {
+		select {
+		case ch <- cfg:
+		default:
+		}
+	}
+	return 0
+}